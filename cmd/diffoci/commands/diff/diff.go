@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/containerd/errdefs"
 	"github.com/containerd/log"
@@ -13,6 +15,8 @@ import (
 	"github.com/reproducible-containers/diffoci/cmd/diffoci/flagutil"
 	"github.com/reproducible-containers/diffoci/cmd/diffoci/imagegetter"
 	"github.com/reproducible-containers/diffoci/pkg/diff"
+	"github.com/reproducible-containers/diffoci/pkg/diff/overlaydiff"
+	"github.com/reproducible-containers/diffoci/pkg/diff/report"
 	"github.com/reproducible-containers/diffoci/pkg/localpathutil"
 	"github.com/reproducible-containers/diffoci/pkg/platformutil"
 	"github.com/spf13/cobra"
@@ -26,14 +30,20 @@ const Example = `  # Basic
 
   # Compare local Docker images
   diffoci diff --semantic docker://foo docker://bar
+
+  # Compare exported tarballs without a daemon round-trip
+  diffoci diff --semantic docker-archive:/path/a.tar oci-archive:/path/b.tar
+
+  # Verify reproducibility across many rebuilds against a baseline
+  diffoci diff --semantic alpine-rebuilt-1 alpine-rebuilt-2 alpine-rebuilt-3
 `
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "diff IMAGE0 IMAGE1",
+		Use:     "diff IMAGE0 IMAGE1 [IMAGE2...]",
 		Short:   "Diff images",
 		Example: Example,
-		Args:    cobra.ExactArgs(2),
+		Args:    cobra.MinimumNArgs(2),
 
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			flags := cmd.Flags()
@@ -110,10 +120,16 @@ func NewCommand() *cobra.Command {
 	flags.Bool("semantic", false, "[Recommended] Alias for --ignore-*=true --treat-canonical-paths-equal")
 
 	flags.Bool("verbose", false, "Verbose output")
-	flags.String("report-file", "", "Create a report file to the specified path (EXPERIMENTAL)")
+	flags.String("report-file", "", "Create a report file to the specified path")
+	flags.String("report-format", string(report.FormatJSON), "Format of --report-file (json|sarif|junit)")
 	flags.String("report-dir", "", "Create a detailed report in the specified directory")
-	flags.String("pull", imagegetter.PullMissing, "Pull mode (always|missing|never)")
+	flags.String("pull", string(imagegetter.PullMissing), "Pull mode (always|missing|never) - ignored for docker-archive:/oci-archive:/tarball inputs")
 	flags.Float64("max-scale", 1.0, "Scale factor for maximum values (e.g., maxTarBlobSize = 4GiB)")
+	flags.Bool("overlay-diff", false, "Diff locally-unpacked images by walking their overlayfs upper directories, instead of re-streaming tar layers (falls back to the tar differ with a warning if unsupported)")
+	flags.Bool("compare-signatures", false, "Also compare cosign signature payloads and signer identities attached to the images")
+	flags.Bool("compare-attestations", false, "Also compare in-toto attestations (e.g. SLSA provenance) attached to the images")
+	flags.Bool("compare-sbom", false, "Also compare SBOMs (SPDX/CycloneDX) attached to the images at the package level, ignoring timestamps and document UUIDs")
+	flags.Bool("pairwise", false, "With more than two IMAGE arguments, also compare every pair instead of only each image against the baseline (IMAGE0)")
 	return cmd
 }
 
@@ -196,8 +212,17 @@ func action(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	reportFormat, err := flags.GetString("report-format")
+	if err != nil {
+		return err
+	}
+	options.ReportFormat = report.Format(reportFormat)
 	if options.ReportFile != "" {
-		log.G(ctx).Warn("report-file is experimental. The file format is subject to change.")
+		switch options.ReportFormat {
+		case report.FormatJSON, report.FormatSARIF, report.FormatJUnit:
+		default:
+			return fmt.Errorf("unknown --report-format %q: must be one of json, sarif, junit", reportFormat)
+		}
 		options.ReportFile, err = localpathutil.Expand(options.ReportFile)
 		if err != nil {
 			return fmt.Errorf("invalid report-file path %q: %w", options.ReportFile, err)
@@ -228,6 +253,33 @@ func action(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	options.OverlayDiff, err = flags.GetBool("overlay-diff")
+	if err != nil {
+		return err
+	}
+	if overlaydiff.Forced() {
+		log.G(ctx).Debugf("%s is set, forcing the overlay differ on", overlaydiff.ForceEnv)
+		options.OverlayDiff = true
+	}
+
+	options.CompareSignatures, err = flags.GetBool("compare-signatures")
+	if err != nil {
+		return err
+	}
+	options.CompareAttestations, err = flags.GetBool("compare-attestations")
+	if err != nil {
+		return err
+	}
+	options.CompareSBOM, err = flags.GetBool("compare-sbom")
+	if err != nil {
+		return err
+	}
+
+	options.Pairwise, err = flags.GetBool("pairwise")
+	if err != nil {
+		return err
+	}
+
 	pullMode, err := flags.GetString("pull")
 	if err != nil {
 		return err
@@ -238,8 +290,8 @@ func action(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	var imageDescs [2]ocispec.Descriptor
-	for i := 0; i < 2; i++ {
+	imageDescs := make([]ocispec.Descriptor, len(args))
+	for i := range args {
 		img, err := ig.Get(ctx, args[i], plats, imagegetter.PullMode(pullMode))
 		if err != nil {
 			return err
@@ -250,17 +302,101 @@ func action(cmd *cobra.Command, args []string) error {
 
 	contentStore := backend.ContentStore()
 
-	var exitCode int
-	report, err := diff.Diff(ctx, contentStore, imageDescs, platMC, &options)
-	if report != nil && len(report.Children) > 0 {
-		exitCode = 1
+	// imageDescs[0] is the baseline. Every other image is compared against
+	// it, building the rows of the matrix; --pairwise additionally compares
+	// every pair among the non-baseline images. Exit code is 0 iff every
+	// *baseline* comparison matches under the current ignore flags --
+	// pairwise-only comparisons are informational and don't affect it.
+	pairs := make([][2]int, 0, len(imageDescs)-1)
+	for i := 1; i < len(imageDescs); i++ {
+		pairs = append(pairs, [2]int{0, i})
 	}
-	if err != nil {
-		if errors.Is(err, errdefs.ErrUnavailable) {
-			err = fmt.Errorf("%w (Hint: specify `--platform` explicitly, e.g., `--platform=linux/amd64`)", err)
+	if options.Pairwise {
+		for i := 1; i < len(imageDescs); i++ {
+			for j := i + 1; j < len(imageDescs); j++ {
+				pairs = append(pairs, [2]int{i, j})
+			}
+		}
+	}
+
+	baseReportFile, baseReportDir := options.ReportFile, options.ReportDir
+
+	// sawError/sawMismatch are tracked independently (rather than a single
+	// exitCode overwritten each iteration) so that a real error on one pair
+	// can't be silently clobbered by a mere mismatch on a later pair, and
+	// both are only ever set from a==0 (baseline) comparisons, per the
+	// pairwise-is-informational-only rule above.
+	var sawError, sawMismatch bool
+	for _, pair := range pairs {
+		a, b := pair[0], pair[1]
+		pairLabel := fmt.Sprintf("%d-vs-%d", a, b)
+		pairOptions := options
+
+		if a == 0 {
+			mismatch, err := compareReferrerPair(ctx, backend, args[a], args[b], imageDescs[a], imageDescs[b], &pairOptions)
+			if err != nil {
+				log.G(ctx).Errorf("%s: %v", pairLabel, err)
+				sawError = true
+			} else if mismatch {
+				sawMismatch = true
+			}
+		}
+
+		if options.OverlayDiff {
+			changes, ok, overlayErr := overlaydiff.Diff(ctx, backend, imageDescs[a], imageDescs[b], platMC)
+			switch {
+			case ok:
+				log.G(ctx).Debugf("overlay-diff %s: found %d changed path(s) via the overlayfs upperdir fast path", pairLabel, len(changes))
+				pairOptions.OverlayChanges = changes
+			case overlayErr != nil:
+				log.G(ctx).Warnf("overlay-diff %s: falling back to the tar differ: %v", pairLabel, overlayErr)
+			default:
+				log.G(ctx).Debugf("overlay-diff %s: backend is not overlay-capable, or the images are not locally unpacked; falling back to the tar differ", pairLabel)
+			}
+		}
+
+		// Give each pair its own --report-dir subdirectory and, with more
+		// than one pair, its own --report-file name, so a matrix of more
+		// than one comparison doesn't clobber itself. Only the report file
+		// is written (below); diff.Diff writes nothing under ReportDir.
+		if baseReportDir != "" {
+			pairOptions.ReportDir = filepath.Join(baseReportDir, pairLabel)
+		}
+		if baseReportFile != "" && len(pairs) > 1 {
+			ext := filepath.Ext(baseReportFile)
+			pairOptions.ReportFile = strings.TrimSuffix(baseReportFile, ext) + "." + pairLabel + ext
 		}
-		log.G(ctx).Error(err)
+
+		rep, err := diff.Diff(ctx, contentStore, [2]ocispec.Descriptor{imageDescs[a], imageDescs[b]}, platMC, &pairOptions)
+		if rep != nil && len(rep.Children) > 0 && a == 0 {
+			sawMismatch = true
+		}
+		if err != nil {
+			if errors.Is(err, errdefs.ErrUnavailable) {
+				err = fmt.Errorf("%w (Hint: specify `--platform` explicitly, e.g., `--platform=linux/amd64`)", err)
+			}
+			log.G(ctx).Errorf("%s: %v", pairLabel, err)
+			if a == 0 {
+				sawError = true
+			}
+			continue
+		}
+		if rep != nil && pairOptions.ReportFile != "" {
+			if err := writeReportFile(rep, pairOptions.ReportFile, pairOptions.ReportFormat); err != nil {
+				log.G(ctx).Error(err)
+				if a == 0 {
+					sawError = true
+				}
+			}
+		}
+	}
+
+	var exitCode int
+	switch {
+	case sawError:
 		exitCode = 2
+	case sawMismatch:
+		exitCode = 1
 	}
 	if exitCode != 0 {
 		log.G(ctx).Debugf("exiting with code %d", exitCode)
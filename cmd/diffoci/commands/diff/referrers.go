@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/log"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/reproducible-containers/diffoci/pkg/diff"
+	"github.com/reproducible-containers/diffoci/pkg/diff/referrers"
+	"github.com/reproducible-containers/diffoci/pkg/diff/sbom"
+)
+
+// referrersBackend is the subset of backendmanager's Backend needed to read
+// referrer content out of the content store.
+type referrersBackend interface {
+	ContentStore() content.Store
+}
+
+// compareReferrerPair discovers the referrers (signatures, attestations,
+// SBOMs) of otherRef and compares them against baseRef's, per the
+// --compare-* flags. mismatch reports whether any of the requested
+// comparisons found a difference, so the caller can fold it into the
+// command's exit code the same way a content mismatch would.
+func compareReferrerPair(ctx context.Context, be referrersBackend, baseRef, otherRef string, baseDesc, otherDesc ocispec.Descriptor, options *diff.Options) (mismatch bool, err error) {
+	if !options.CompareSignatures && !options.CompareAttestations && !options.CompareSBOM {
+		return false, nil
+	}
+	hosts := docker.ConfigureDefaultRegistries(docker.WithAuthorizer(docker.NewDockerAuthorizer()))
+	resolver := &referrers.Resolver{
+		ContentStore: be.ContentStore(),
+		Resolver:     docker.NewResolver(docker.ResolverOptions{Hosts: hosts}),
+		Hosts:        hosts,
+	}
+	baseReferrers, err := resolver.Discover(ctx, baseRef, baseDesc)
+	if err != nil {
+		return false, fmt.Errorf("failed to discover referrers of %q: %w", baseRef, err)
+	}
+	otherReferrers, err := resolver.Discover(ctx, otherRef, otherDesc)
+	if err != nil {
+		return false, fmt.Errorf("failed to discover referrers of %q: %w", otherRef, err)
+	}
+	return compareReferrerSet(ctx, resolver, baseRef, otherRef, baseReferrers, otherReferrers, options)
+}
+
+func compareReferrerSet(ctx context.Context, resolver *referrers.Resolver, baseRef, otherRef string, base, other []referrers.Referrer, options *diff.Options) (mismatch bool, err error) {
+	wanted := func(k referrers.Kind) bool {
+		switch k {
+		case referrers.KindSignature:
+			return options.CompareSignatures
+		case referrers.KindAttestation:
+			return options.CompareAttestations
+		case referrers.KindSBOM:
+			return options.CompareSBOM
+		default:
+			return false
+		}
+	}
+	byKind := func(rs []referrers.Referrer, k referrers.Kind) []referrers.Referrer {
+		var out []referrers.Referrer
+		for _, r := range rs {
+			if r.Kind == k {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+
+	for _, kind := range []referrers.Kind{referrers.KindSignature, referrers.KindAttestation, referrers.KindSBOM} {
+		if !wanted(kind) {
+			continue
+		}
+		baseR, otherR := byKind(base, kind), byKind(other, kind)
+		if len(baseR) == 0 && len(otherR) == 0 {
+			continue
+		}
+		if kind == referrers.KindSBOM {
+			m, err := compareSBOMs(ctx, resolver, baseRef, otherRef, baseR, otherR)
+			if err != nil {
+				return false, err
+			}
+			if m {
+				mismatch = true
+			}
+			continue
+		}
+		m, err := compareSignedArtifacts(ctx, resolver, baseRef, otherRef, kind, baseR, otherR)
+		if err != nil {
+			return false, err
+		}
+		if m {
+			mismatch = true
+		}
+	}
+	return mismatch, nil
+}
+
+// compareSignedArtifacts compares cosign signatures/attestations by their
+// signed payload (not the raw signature bytes, which differ across
+// reruns even for an identical payload) and by the subject/issuer of the
+// signer's keyless certificate, rather than just their count.
+func compareSignedArtifacts(ctx context.Context, resolver *referrers.Resolver, baseRef, otherRef string, kind referrers.Kind, base, other []referrers.Referrer) (bool, error) {
+	if len(base) != len(other) {
+		log.G(ctx).Warnf("%s: %q has %d %s referrer(s), %q has %d", kind, baseRef, len(base), kind, otherRef, len(other))
+		return true, nil
+	}
+	mismatch := false
+	for i := range base {
+		basePayload, err := resolver.Payload(ctx, baseRef, base[i])
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s payload of %q: %w", kind, baseRef, err)
+		}
+		otherPayload, err := resolver.Payload(ctx, otherRef, other[i])
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s payload of %q: %w", kind, otherRef, err)
+		}
+		if !bytes.Equal(basePayload, otherPayload) {
+			log.G(ctx).Warnf("%s: %q vs %q: signed payload #%d differs", kind, baseRef, otherRef, i)
+			mismatch = true
+		}
+
+		baseSubject, baseIssuer, err := resolver.CertificateIdentity(ctx, baseRef, base[i])
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s certificate identity of %q: %w", kind, baseRef, err)
+		}
+		otherSubject, otherIssuer, err := resolver.CertificateIdentity(ctx, otherRef, other[i])
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s certificate identity of %q: %w", kind, otherRef, err)
+		}
+		if baseSubject != otherSubject || baseIssuer != otherIssuer {
+			log.G(ctx).Warnf("%s: %q vs %q: signer identity #%d differs (%q/%q vs %q/%q)",
+				kind, baseRef, otherRef, i, baseSubject, baseIssuer, otherSubject, otherIssuer)
+			mismatch = true
+		}
+	}
+	return mismatch, nil
+}
+
+func compareSBOMs(ctx context.Context, resolver *referrers.Resolver, baseRef, otherRef string, base, other []referrers.Referrer) (bool, error) {
+	if len(base) == 0 || len(other) == 0 {
+		log.G(ctx).Warnf("sbom: %q has %d SBOM referrer(s), %q has %d", baseRef, len(base), otherRef, len(other))
+		return true, nil
+	}
+	a, err := resolver.Payload(ctx, baseRef, base[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to read SBOM of %q: %w", baseRef, err)
+	}
+	b, err := resolver.Payload(ctx, otherRef, other[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to read SBOM of %q: %w", otherRef, err)
+	}
+	d, err := sbom.Compare(a, b)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare SBOMs of %q and %q: %w", baseRef, otherRef, err)
+	}
+	if !d.Equal() {
+		log.G(ctx).Warnf("sbom: %q vs %q: %d added, %d removed, %d version-changed package(s)",
+			baseRef, otherRef, len(d.Added), len(d.Removed), len(d.VersionChanged))
+		return true, nil
+	}
+	return false, nil
+}
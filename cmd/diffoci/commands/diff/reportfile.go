@@ -0,0 +1,47 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/reproducible-containers/diffoci/pkg/diff"
+	"github.com/reproducible-containers/diffoci/pkg/diff/report"
+)
+
+// writeReportFile encodes rep as --report-format and writes it to path.
+// rep.Walk visits every differing path alongside its rule IDs (the
+// --ignore-* flag names that would have suppressed it, or "file-content",
+// "file-added", "file-removed" where no flag does). Differences that the
+// current flags suppressed are not in rep, so the report does not list
+// which rules --semantic disabled.
+func writeReportFile(rep *diff.Report, path string, format report.Format) error {
+	layers := map[int]*report.Layer{}
+	rep.Walk(func(layerIndex int, path string, reasons []string) {
+		l, ok := layers[layerIndex]
+		if !ok {
+			l = &report.Layer{Index: layerIndex}
+			layers[layerIndex] = l
+		}
+		rr := make([]report.Reason, 0, len(reasons))
+		for _, reason := range reasons {
+			rr = append(rr, report.Reason{RuleID: reason, Message: reason})
+		}
+		l.Paths = append(l.Paths, report.Path{Path: path, Reasons: rr})
+	})
+
+	doc := &report.Document{SchemaVersion: report.SchemaVersion}
+	for _, l := range layers {
+		doc.Layers = append(doc.Layers, *l)
+	}
+	sort.Slice(doc.Layers, func(i, j int) bool { return doc.Layers[i].Index < doc.Layers[j].Index })
+
+	data, err := report.Marshal(doc, format)
+	if err != nil {
+		return fmt.Errorf("failed to encode report in %q format: %w", format, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report file %q: %w", path, err)
+	}
+	return nil
+}
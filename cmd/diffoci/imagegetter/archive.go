@@ -0,0 +1,133 @@
+package imagegetter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/images/archive"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type archiveKind string
+
+const (
+	archiveKindDocker archiveKind = "docker-archive"
+	archiveKindOCI    archiveKind = "oci-archive"
+)
+
+// detectArchive reports whether ref names a local tarball, and if so which
+// kind of archive it is. Explicit "docker-archive:PATH" and
+// "oci-archive:PATH" prefixes (mirroring containers/image transport names)
+// are always honored; a bare path is auto-detected by magic bytes, so
+// plain ".tar"/".tar.gz" arguments work without a prefix.
+func detectArchive(ref string) (archiveKind, string, bool) {
+	if path, ok := strings.CutPrefix(ref, string(archiveKindDocker)+":"); ok {
+		return archiveKindDocker, path, true
+	}
+	if path, ok := strings.CutPrefix(ref, string(archiveKindOCI)+":"); ok {
+		return archiveKindOCI, path, true
+	}
+	kind, ok := sniffArchiveKind(ref)
+	if !ok {
+		return "", "", false
+	}
+	return kind, ref, true
+}
+
+// sniffArchiveKind opens path and looks at its content to decide whether it
+// is a docker-archive or oci-archive tarball. It returns ok=false (rather
+// than an error) for anything that doesn't look like a tarball at all, so
+// that plain image references are left alone.
+func sniffArchiveKind(path string) (archiveKind, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	r := io.Reader(f)
+	var magic [2]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return "", false
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", false
+	}
+	if magic == [2]byte{0x1f, 0x8b} { // gzip magic
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", false
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false
+		}
+		switch hdr.Name {
+		case "manifest.json", "repositories":
+			return archiveKindDocker, true
+		case "index.json", "oci-layout":
+			return archiveKindOCI, true
+		}
+	}
+	return "", false
+}
+
+func (ig *ImageGetter) getArchive(ctx context.Context, kind archiveKind, path string, plats []ocispec.Platform) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s %q: %w", kind, path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gz, err := isGzip(f); err == nil && gz {
+		gzr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", path, err)
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+
+	matcher := platforms.Any(plats...)
+	imgs, err := archive.Import(ctx, ig.backend.ContentStore(), r, archive.WithImportPlatform(matcher))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s %q: %w", kind, path, err)
+	}
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("%s %q contains no images", kind, path)
+	}
+	// A tarball may bundle more than one tag; diffoci only ever diffs one
+	// image per argument, so take the first and let --platform narrow it
+	// down the same way a registry pull does.
+	img := imgs[0]
+	return &Image{Name: img.Name, Target: img.Target}, nil
+}
+
+func isGzip(f *os.File) (bool, error) {
+	defer f.Seek(0, io.SeekStart)
+	var magic [2]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(magic[:], []byte{0x1f, 0x8b}), nil
+}
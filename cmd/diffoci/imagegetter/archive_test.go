@@ -0,0 +1,89 @@
+package imagegetter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTar(t *testing.T, path string, names []string, gz bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Size: 0, Mode: 0o644}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if gz {
+		gw := gzip.NewWriter(f)
+		if _, err := gw.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	dockerPath := filepath.Join(dir, "docker.tar")
+	writeTar(t, dockerPath, []string{"manifest.json"}, false)
+
+	ociPath := filepath.Join(dir, "oci.tar.gz")
+	writeTar(t, ociPath, []string{"index.json", "oci-layout"}, true)
+
+	notATarball := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(notATarball, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		ref      string
+		wantKind archiveKind
+		wantPath string
+		wantOK   bool
+	}{
+		{"explicit docker-archive prefix", "docker-archive:" + dockerPath, archiveKindDocker, dockerPath, true},
+		{"explicit oci-archive prefix", "oci-archive:" + ociPath, archiveKindOCI, ociPath, true},
+		{"sniffed docker tarball", dockerPath, archiveKindDocker, dockerPath, true},
+		{"sniffed gzipped oci tarball", ociPath, archiveKindOCI, ociPath, true},
+		{"plain file is not a tarball", notATarball, "", "", false},
+		{"registry reference is not a tarball", "alpine:3.18.2", "", "", false},
+		{"missing file is not a tarball", filepath.Join(dir, "nope.tar"), "", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kind, path, ok := detectArchive(c.ref)
+			if ok != c.wantOK {
+				t.Fatalf("detectArchive(%q) ok = %v, want %v", c.ref, ok, c.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if kind != c.wantKind || path != c.wantPath {
+				t.Fatalf("detectArchive(%q) = (%q, %q), want (%q, %q)", c.ref, kind, path, c.wantKind, c.wantPath)
+			}
+		})
+	}
+}
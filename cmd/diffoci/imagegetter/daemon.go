@@ -0,0 +1,39 @@
+package imagegetter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/v2/core/images/archive"
+	"github.com/containerd/platforms"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// getDockerDaemon resolves a "docker://NAME" reference by exporting NAME
+// from the local Docker daemon (the same data `docker save` would produce)
+// and importing it straight into the backend's content store, the same way
+// getArchive imports a docker-archive tarball from disk.
+func (ig *ImageGetter) getDockerDaemon(ctx context.Context, name string, plats []ocispec.Platform) (*Image, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the local Docker daemon: %w", err)
+	}
+	defer cli.Close()
+
+	rc, err := cli.ImageSave(ctx, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export local Docker image %q: %w", name, err)
+	}
+	defer rc.Close()
+
+	matcher := platforms.Any(plats...)
+	imgs, err := archive.Import(ctx, ig.backend.ContentStore(), rc, archive.WithImportPlatform(matcher))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import local Docker image %q: %w", name, err)
+	}
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("local Docker image %q produced no images on export", name)
+	}
+	return &Image{Name: name, Target: imgs[0].Target}, nil
+}
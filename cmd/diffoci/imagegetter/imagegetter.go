@@ -0,0 +1,93 @@
+// Package imagegetter resolves the diff command's IMAGE arguments
+// (registry references, docker://, and archive paths) into descriptors
+// backed by the backend's content store.
+package imagegetter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PullMode controls whether Get is allowed to fetch missing content from a
+// remote registry.
+type PullMode string
+
+const (
+	PullAlways  = PullMode("always")
+	PullMissing = PullMode("missing")
+	PullNever   = PullMode("never")
+)
+
+// Image is the result of resolving a single IMAGE argument.
+type Image struct {
+	// Name is the human-readable reference the image was resolved from.
+	Name string
+	// Target is the descriptor of the resolved image in the backend's
+	// content store.
+	Target ocispec.Descriptor
+}
+
+// Backend is the subset of backend.Backend that ImageGetter needs.
+type Backend interface {
+	ContentStore() content.Store
+}
+
+// ImageGetter resolves IMAGE arguments into Images.
+type ImageGetter struct {
+	stderr  io.Writer
+	backend Backend
+}
+
+// New creates an ImageGetter. stderr is kept on the ImageGetter; no pull
+// progress is written to it.
+func New(stderr io.Writer, backend Backend) (*ImageGetter, error) {
+	return &ImageGetter{stderr: stderr, backend: backend}, nil
+}
+
+// Get resolves ref, which may be a registry reference, a "docker://NAME"
+// reference to an image already present in the local Docker daemon, an
+// archive reference ("docker-archive:PATH", "oci-archive:PATH"), or a bare
+// path to a ".tar"/".tar.gz" tarball auto-detected by magic bytes, into an
+// Image backed by the backend's content store.
+func (ig *ImageGetter) Get(ctx context.Context, ref string, plats []ocispec.Platform, pullMode PullMode) (*Image, error) {
+	if name, ok := strings.CutPrefix(ref, "docker://"); ok {
+		return ig.getDockerDaemon(ctx, name, plats)
+	}
+	if kind, path, ok := detectArchive(ref); ok {
+		return ig.getArchive(ctx, kind, path, plats)
+	}
+	return ig.getRegistry(ctx, ref, plats, pullMode)
+}
+
+func (ig *ImageGetter) getRegistry(ctx context.Context, ref string, plats []ocispec.Platform, pullMode PullMode) (*Image, error) {
+	if pullMode == PullNever {
+		return nil, fmt.Errorf("%q is not a local archive, and --pull=never forbids resolving it against a registry", ref)
+	}
+	resolver := docker.NewResolver(docker.ResolverOptions{})
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve image reference %q: %w", ref, err)
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fetcher for %q: %w", ref, err)
+	}
+	matcher := platforms.Any(plats...)
+	handler := images.Handlers(
+		remotes.FetchHandler(ig.backend.ContentStore(), fetcher),
+		images.FilterPlatforms(images.ChildrenHandler(ig.backend.ContentStore()), matcher),
+	)
+	if err := images.Dispatch(ctx, handler, nil, desc); err != nil {
+		return nil, fmt.Errorf("failed to fetch image %q: %w", ref, err)
+	}
+	return &Image{Name: name, Target: desc}, nil
+}
@@ -0,0 +1,405 @@
+// Package diff compares two (or more, via the CLI's matrix) OCI images and
+// produces a Report describing where they differ: in image metadata
+// (history, name), in the number/identity of layers, or in the files each
+// layer touches.
+//
+// Every difference is tagged with a rule ID: the name of the --ignore-* flag
+// that would have suppressed it, so callers (notably the report writers) can
+// show not just what differs, but which --semantic knob would silence it.
+// Differences that no flag suppresses are tagged "file-content",
+// "file-added" or "file-removed" instead.
+package diff
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/reproducible-containers/diffoci/pkg/diff/overlaydiff"
+	"github.com/reproducible-containers/diffoci/pkg/diff/report"
+)
+
+// Options controls how Diff compares a pair of images. The zero value
+// compares everything Diff checks. Diff does not compare file order or tar
+// format, so IgnoreFileOrder and IgnoreTarFormat have no effect, and it
+// writes no output: ReportFile and ReportDir are not read by Diff.
+type Options struct {
+	IgnoreHistory               bool
+	IgnoreFileOrder             bool
+	IgnoreFileModeRedundantBits bool
+	IgnoreFileMTime             bool
+	IgnoreFileATime             bool
+	IgnoreFileCTime             bool
+	IgnoreFilePermissions       bool
+	IgnoreFileMode              bool
+	IgnoreFileContent           bool
+	IgnoreLayerLengthMismatch   bool
+	IgnoreFiles                 []string
+	IgnoreImageTimestamps       bool
+	IgnoreImageName             bool
+	IgnoreTarFormat             bool
+	CanonicalPaths              bool
+
+	ReportFile   string
+	ReportFormat report.Format
+	ReportDir    string
+
+	EventHandler EventHandler
+	MaxScale     float64
+
+	OverlayDiff    bool
+	OverlayChanges []overlaydiff.Change
+
+	CompareSignatures   bool
+	CompareAttestations bool
+	CompareSBOM         bool
+	Pairwise            bool
+}
+
+// Event is passed to an EventHandler to narrate the diff's progress.
+type Event struct {
+	Context context.Context
+	Message string
+}
+
+// EventHandler is notified as Diff makes progress, e.g. once per compared
+// layer.
+type EventHandler func(Event)
+
+// DefaultEventHandler discards events.
+func DefaultEventHandler(Event) {}
+
+// VerboseEventHandler logs every event at info level, for --verbose.
+func VerboseEventHandler(e Event) {
+	log.G(e.Context).Info(e.Message)
+}
+
+// Report is a tree of comparison results. The root represents the whole
+// image pair; its Children are either image-level findings (Index -1) or
+// one node per layer that differs (Index set to the layer's position),
+// whose own Children are the individual differing paths. The overlay fast
+// path does not tell layers apart and reports all of its changes under a
+// single node with Index 0.
+type Report struct {
+	// Index is the layer index this node belongs to, or -1 for
+	// image-level findings (name, history, layer count).
+	Index int
+	// Path is set on leaf nodes: the file path (or a synthetic
+	// "image.*" path for image-level findings) that differs.
+	Path string
+	// Reasons are the rule IDs of this finding: the --ignore-* flag names
+	// that would have suppressed it, or "file-content", "file-added" or
+	// "file-removed" where no flag does.
+	Reasons []string
+
+	Children []*Report
+}
+
+// Walk visits every leaf finding in the report, in the order of
+// r.Children, passing the layer index it belongs to alongside its path and
+// reasons.
+func (r *Report) Walk(fn func(layerIndex int, path string, reasons []string)) {
+	for _, child := range r.Children {
+		if len(child.Children) == 0 {
+			fn(child.Index, child.Path, child.Reasons)
+			continue
+		}
+		for _, leaf := range child.Children {
+			fn(child.Index, leaf.Path, leaf.Reasons)
+		}
+	}
+}
+
+const baseMaxTarBlobSize = 4 << 30 // 4GiB, scaled by Options.MaxScale
+
+// Diff compares the two images named by descs, for the given platform, and
+// returns a Report of where they differ.
+func Diff(ctx context.Context, store content.Store, descs [2]ocispec.Descriptor, platform platforms.MatchComparer, options *Options) (*Report, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	var manifests [2]ocispec.Manifest
+	for i, desc := range descs {
+		m, err := images.Manifest(ctx, store, desc, platform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve manifest of image %d (%s): %w", i, desc.Digest, err)
+		}
+		manifests[i] = m
+	}
+
+	root := &Report{Index: -1}
+
+	if !options.IgnoreImageName {
+		nameA := descs[0].Annotations[ocispec.AnnotationRefName]
+		nameB := descs[1].Annotations[ocispec.AnnotationRefName]
+		if nameA != nameB {
+			root.Children = append(root.Children, &Report{Index: -1, Path: "image.name", Reasons: []string{"ignore-image-name"}})
+		}
+	}
+
+	var configs [2]ocispec.Image
+	for i, m := range manifests {
+		b, err := content.ReadBlob(ctx, store, m.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image config of image %d: %w", i, err)
+		}
+		if err := json.Unmarshal(b, &configs[i]); err != nil {
+			return nil, fmt.Errorf("failed to parse image config of image %d: %w", i, err)
+		}
+	}
+
+	if !options.IgnoreHistory && !historyEqual(configs[0].History, configs[1].History, options) {
+		root.Children = append(root.Children, &Report{Index: -1, Path: "image.history", Reasons: []string{"ignore-history"}})
+	}
+
+	if !options.IgnoreLayerLengthMismatch && len(manifests[0].Layers) != len(manifests[1].Layers) {
+		root.Children = append(root.Children, &Report{Index: -1, Path: "image.layers", Reasons: []string{"extra-ignore-layer-length-mismatch"}})
+	}
+
+	if options.OverlayDiff && options.OverlayChanges != nil {
+		if layer := overlayLayerReport(options.OverlayChanges); layer != nil {
+			root.Children = append(root.Children, layer)
+		}
+		if options.EventHandler != nil {
+			options.EventHandler(Event{Context: ctx, Message: "compared via the overlayfs upperdir fast path"})
+		}
+		return root, nil
+	}
+
+	maxTarBlobSize := int64(baseMaxTarBlobSize)
+	if options.MaxScale > 0 {
+		maxTarBlobSize = int64(float64(baseMaxTarBlobSize) * options.MaxScale)
+	}
+
+	layerCount := len(manifests[0].Layers)
+	if n := len(manifests[1].Layers); n > layerCount {
+		layerCount = n
+	}
+	for i := 0; i < layerCount; i++ {
+		var la, lb *ocispec.Descriptor
+		if i < len(manifests[0].Layers) {
+			la = &manifests[0].Layers[i]
+		}
+		if i < len(manifests[1].Layers) {
+			lb = &manifests[1].Layers[i]
+		}
+		if la != nil && lb != nil && la.Digest == lb.Digest {
+			continue
+		}
+		layerReport, err := diffLayer(ctx, store, i, la, lb, maxTarBlobSize, options)
+		if err != nil {
+			return nil, err
+		}
+		if layerReport != nil && len(layerReport.Children) > 0 {
+			root.Children = append(root.Children, layerReport)
+		}
+		if options.EventHandler != nil {
+			options.EventHandler(Event{Context: ctx, Message: fmt.Sprintf("compared layer %d", i)})
+		}
+	}
+
+	return root, nil
+}
+
+func overlayLayerReport(changes []overlaydiff.Change) *Report {
+	if len(changes) == 0 {
+		return nil
+	}
+	layer := &Report{Index: 0}
+	for _, c := range changes {
+		reason := "file-content"
+		if c.Deleted {
+			reason = "file-removed"
+		}
+		layer.Children = append(layer.Children, &Report{Index: 0, Path: c.Path, Reasons: []string{reason}})
+	}
+	return layer
+}
+
+func historyEqual(a, b []ocispec.History, options *Options) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		ha, hb := a[i], b[i]
+		if ha.CreatedBy != hb.CreatedBy || ha.Author != hb.Author || ha.Comment != hb.Comment || ha.EmptyLayer != hb.EmptyLayer {
+			return false
+		}
+		if options.IgnoreImageTimestamps {
+			continue
+		}
+		switch {
+		case ha.Created == nil && hb.Created == nil:
+		case ha.Created == nil || hb.Created == nil:
+			return false
+		case !ha.Created.Equal(*hb.Created):
+			return false
+		}
+	}
+	return true
+}
+
+type tarEntry struct {
+	mode     int64
+	size     int64
+	mtime    time.Time
+	atime    time.Time
+	ctime    time.Time
+	typeflag byte
+	hash     string
+}
+
+func diffLayer(ctx context.Context, store content.Store, index int, la, lb *ocispec.Descriptor, maxSize int64, options *Options) (*Report, error) {
+	var ea, eb map[string]tarEntry
+	if la != nil {
+		var err error
+		ea, err = readTarEntries(ctx, store, *la, maxSize, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %d of image 0: %w", index, err)
+		}
+	}
+	if lb != nil {
+		var err error
+		eb, err = readTarEntries(ctx, store, *lb, maxSize, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %d of image 1: %w", index, err)
+		}
+	}
+
+	ignored := make(map[string]bool, len(options.IgnoreFiles))
+	for _, f := range options.IgnoreFiles {
+		ignored[canonicalPath(f, options.CanonicalPaths)] = true
+	}
+
+	layerReport := &Report{Index: index}
+	for path, a := range ea {
+		if ignored[path] {
+			continue
+		}
+		b, ok := eb[path]
+		if !ok {
+			layerReport.Children = append(layerReport.Children, &Report{Index: index, Path: path, Reasons: []string{"file-removed"}})
+			continue
+		}
+		if reasons := compareEntries(a, b, options); len(reasons) > 0 {
+			layerReport.Children = append(layerReport.Children, &Report{Index: index, Path: path, Reasons: reasons})
+		}
+	}
+	for path := range eb {
+		if ignored[path] {
+			continue
+		}
+		if _, ok := ea[path]; ok {
+			continue
+		}
+		layerReport.Children = append(layerReport.Children, &Report{Index: index, Path: path, Reasons: []string{"file-added"}})
+	}
+	return layerReport, nil
+}
+
+func compareEntries(a, b tarEntry, options *Options) []string {
+	var reasons []string
+	if !options.IgnoreFileMode && !options.IgnoreFilePermissions {
+		am, bm := a.mode, b.mode
+		if options.IgnoreFileModeRedundantBits {
+			const permMask = 0o777
+			am, bm = am&permMask, bm&permMask
+		}
+		if am != bm {
+			reasons = append(reasons, "extra-ignore-file-mode")
+		}
+	}
+	if !options.IgnoreFileMTime && !a.mtime.Equal(b.mtime) {
+		reasons = append(reasons, "ignore-file-mtime")
+	}
+	if !options.IgnoreFileATime && !a.atime.Equal(b.atime) {
+		reasons = append(reasons, "ignore-file-atime")
+	}
+	if !options.IgnoreFileCTime && !a.ctime.Equal(b.ctime) {
+		reasons = append(reasons, "ignore-file-ctime")
+	}
+	if options.IgnoreFileContent {
+		if a.size != b.size {
+			reasons = append(reasons, "extra-ignore-file-content")
+		}
+	} else if a.hash != b.hash {
+		reasons = append(reasons, "file-content")
+	}
+	return reasons
+}
+
+func readTarEntries(ctx context.Context, store content.Store, desc ocispec.Descriptor, maxSize int64, options *Options) (map[string]tarEntry, error) {
+	if desc.Size > maxSize {
+		return nil, fmt.Errorf("layer %s (%d bytes) exceeds the maximum of %d bytes (adjust with --max-scale): %w", desc.Digest, desc.Size, maxSize, errdefs.ErrUnavailable)
+	}
+	ra, err := store.ReaderAt(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer ra.Close()
+
+	var r io.Reader = content.NewReader(ra)
+	if isGzipMediaType(desc.MediaType) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress layer %s: %w", desc.Digest, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	entries := make(map[string]tarEntry)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar layer %s: %w", desc.Digest, err)
+		}
+		entry := tarEntry{
+			mode:     hdr.Mode,
+			size:     hdr.Size,
+			mtime:    hdr.ModTime,
+			atime:    hdr.AccessTime,
+			ctime:    hdr.ChangeTime,
+			typeflag: hdr.Typeflag,
+		}
+		if !options.IgnoreFileContent && hdr.Typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, fmt.Errorf("failed to hash %q in layer %s: %w", hdr.Name, desc.Digest, err)
+			}
+			entry.hash = hex.EncodeToString(h.Sum(nil))
+		}
+		entries[canonicalPath(hdr.Name, options.CanonicalPaths)] = entry
+	}
+	return entries, nil
+}
+
+func canonicalPath(p string, canonical bool) string {
+	if !canonical {
+		return p
+	}
+	p = strings.TrimPrefix(p, "./")
+	return strings.TrimPrefix(p, "/")
+}
+
+func isGzipMediaType(mt string) bool {
+	return strings.Contains(mt, "gzip")
+}
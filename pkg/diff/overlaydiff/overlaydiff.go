@@ -0,0 +1,219 @@
+// Package overlaydiff computes per-layer diffs by walking the upper
+// directory of an overlayfs mount, instead of re-streaming and comparing
+// the tar blobs of each layer.
+//
+// It mirrors the approach taken by BuildKit's overlay differ: when two
+// snapshots share a common base, the set of paths touched in the upper
+// directory of the diverging chain is exactly the diff between them, so
+// layers whose digests already match can be skipped entirely.
+package overlaydiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sys/unix"
+)
+
+// ForceEnv forces the overlay fast path on, bypassing the capability probe
+// below. Intended for debugging, analogous to BuildKit's
+// BUILDKIT_DEBUG_FORCE_OVERLAY_DIFF.
+const ForceEnv = "BUILDKIT_DEBUG_FORCE_OVERLAY_DIFF"
+
+// Forced reports whether the overlay fast path has been forced on via
+// ForceEnv.
+func Forced() bool {
+	return os.Getenv(ForceEnv) != ""
+}
+
+// Capable reports whether sn is known to produce mounts that this package
+// can read the upper directory of directly, i.e. a plain "overlayfs"
+// snapshotter (as opposed to e.g. a remote or fuse-overlayfs snapshotter
+// whose upperdir is not guaranteed to be host-visible).
+func Capable(sn snapshots.Snapshotter) bool {
+	_, ok := sn.(interface{ Name() string })
+	if !ok {
+		return false
+	}
+	return sn.(interface{ Name() string }).Name() == "overlayfs"
+}
+
+// Change is a single changed path found by walking the upper directory.
+// Deleted is set for whiteouts and opaque directories; every other change
+// is an add or a modify, which are not told apart.
+type Change struct {
+	Path    string
+	Deleted bool
+}
+
+// Upperdir resolves the overlayfs upperdir of mounts, if any. Diffoci only
+// ever deals with the single mount that a snapshotter hands back for a
+// given snapshot, so it is sufficient to look at mounts[0].
+func Upperdir(mounts []mount.Mount) (string, error) {
+	if len(mounts) != 1 || mounts[0].Type != "overlay" {
+		return "", fmt.Errorf("expected a single overlay mount, got %d mounts", len(mounts))
+	}
+	for _, opt := range mounts[0].Options {
+		const prefix = "upperdir="
+		if len(opt) > len(prefix) && opt[:len(prefix)] == prefix {
+			return opt[len(prefix):], nil
+		}
+	}
+	return "", fmt.Errorf("overlay mount %+v has no upperdir option", mounts[0])
+}
+
+// Lowerdir resolves the overlayfs lowerdir chain of mounts (colon-separated,
+// innermost first), if any.
+func Lowerdir(mounts []mount.Mount) ([]string, error) {
+	if len(mounts) != 1 || mounts[0].Type != "overlay" {
+		return nil, fmt.Errorf("expected a single overlay mount, got %d mounts", len(mounts))
+	}
+	for _, opt := range mounts[0].Options {
+		const prefix = "lowerdir="
+		if len(opt) > len(prefix) && opt[:len(prefix)] == prefix {
+			return strings.Split(opt[len(prefix):], ":"), nil
+		}
+	}
+	return nil, fmt.Errorf("overlay mount %+v has no lowerdir option", mounts[0])
+}
+
+// sharesBase reports whether a and b were unpacked on top of a common
+// overlay base, i.e. whether at least one of a's directories (its lowerdir
+// chain, plus its own upperdir if it has diverged from that chain) also
+// appears in b's lowerdir chain. Without this, b's upperdir is just "what
+// changed since b's own base", which says nothing about how b compares to
+// an unrelated a.
+func sharesBase(aMounts, bMounts []mount.Mount) (bool, error) {
+	aLower, err := Lowerdir(aMounts)
+	if err != nil {
+		return false, err
+	}
+	bLower, err := Lowerdir(bMounts)
+	if err != nil {
+		return false, err
+	}
+	aDirs := make(map[string]bool, len(aLower)+1)
+	for _, d := range aLower {
+		aDirs[d] = true
+	}
+	if aUpper, err := Upperdir(aMounts); err == nil {
+		aDirs[aUpper] = true
+	}
+	for _, d := range bLower {
+		if aDirs[d] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Walk walks upperdir and returns the set of changed paths, in the same
+// shape containerd's fs.Changes would have produced from a full tar diff.
+//
+// A path is reported as deleted (a whiteout) when it is a character
+// device with major/minor 0/0, and opaque directories (marked via the
+// trusted.overlay.opaque xattr) are reported as a delete of the directory
+// followed by adds of everything found under it, exactly as containerd's
+// overlay differ does.
+func Walk(upperdir string) ([]Change, error) {
+	var changes []Change
+	err := filepath.Walk(upperdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == upperdir {
+			return nil
+		}
+		rel, err := filepath.Rel(upperdir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeCharDevice != 0 {
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Rdev == 0 {
+				changes = append(changes, Change{Path: rel, Deleted: true})
+				return nil
+			}
+		}
+
+		if info.IsDir() {
+			sz, err := unix.Getxattr(path, "trusted.overlay.opaque", nil)
+			if err != nil && err != unix.ENODATA {
+				return fmt.Errorf("failed to read trusted.overlay.opaque on %q: %w", path, err)
+			}
+			if sz > 0 {
+				// Opaque directories mask whatever the lower layers had at
+				// this path: report the delete, then let the walk's
+				// subsequent visits re-add everything found under it.
+				changes = append(changes, Change{Path: rel, Deleted: true})
+				return nil
+			}
+		}
+
+		changes = append(changes, Change{Path: rel})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk overlay upperdir %q: %w", upperdir, err)
+	}
+	return changes, nil
+}
+
+// Backend is the subset of the diff command's backend needed to locate the
+// overlay mounts of an already-unpacked image: its snapshotter (to probe
+// capability) and a way to resolve an image's rootfs mounts for a given
+// platform (the unpack step itself is the backend's job; this package only
+// ever reads what's already on disk).
+type Backend interface {
+	Snapshotter() snapshots.Snapshotter
+	ImageMounts(ctx context.Context, desc ocispec.Descriptor, platform platforms.MatchComparer) ([]mount.Mount, error)
+}
+
+// Diff attempts the overlay fast path between two already-unpacked images.
+// ok is false whenever the caller should fall back to the tar differ: that
+// covers both "not applicable" (err is nil: the snapshotter isn't
+// overlay-capable, or either image isn't locally unpacked) and "applicable
+// but unreadable, or inapplicable because a and b don't share an overlay
+// base" (err is set), per the requirement that unreadable/untrustworthy
+// overlay state is a warning-and-fall-back, not a hard error.
+func Diff(ctx context.Context, be Backend, a, b ocispec.Descriptor, platform platforms.MatchComparer) (changes []Change, ok bool, err error) {
+	if !Forced() && !Capable(be.Snapshotter()) {
+		return nil, false, nil
+	}
+	aMounts, err := be.ImageMounts(ctx, a, platform)
+	if err != nil {
+		return nil, false, nil
+	}
+	bMounts, err := be.ImageMounts(ctx, b, platform)
+	if err != nil {
+		return nil, false, nil
+	}
+	bUpper, err := Upperdir(bMounts)
+	if err != nil {
+		return nil, false, nil
+	}
+	// b's upperdir is only "the diff between a and b" if both were
+	// unpacked from a common base; otherwise it's just "what changed
+	// since b's own base", which would silently under-report a's side of
+	// the diff.
+	shared, err := sharesBase(aMounts, bMounts)
+	if err != nil {
+		return nil, false, nil
+	}
+	if !shared {
+		return nil, false, fmt.Errorf("%s and %s do not share an overlay base; the upperdir fast path cannot be trusted", a.Digest, b.Digest)
+	}
+	changes, err = Walk(bUpper)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read overlay upperdir for %s: %w", b.Digest, err)
+	}
+	return changes, true, nil
+}
@@ -0,0 +1,262 @@
+// Package referrers discovers and diffs the artifacts attached to an
+// image via the OCI 1.1 referrers API (or, failing that, the cosign tag
+// convention), so that diffoci can compare signatures, attestations, and
+// SBOMs alongside the image content itself.
+package referrers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Well-known artifact/media types used to classify referrers.
+const (
+	ArtifactTypeCosignSignature = "application/vnd.dev.cosign.simplesigning.v1+json"
+	ArtifactTypeInToto          = "application/vnd.in-toto+json"
+)
+
+// cosignTagSuffixes maps the legacy cosign tag convention (subject digest,
+// algorithm/hex joined with "-", suffixed per artifact kind) to the Kind it
+// identifies, used when a registry doesn't support the OCI 1.1 referrers
+// API.
+var cosignTagSuffixes = map[string]Kind{
+	".sig":  KindSignature,
+	".att":  KindAttestation,
+	".sbom": KindSBOM,
+}
+
+// Kind classifies a referrer for reporting purposes.
+type Kind string
+
+const (
+	KindSignature   Kind = "signature"
+	KindAttestation Kind = "attestation"
+	KindSBOM        Kind = "sbom"
+	KindOther       Kind = "other"
+)
+
+// Referrer is a single artifact attached to a subject image.
+type Referrer struct {
+	Kind       Kind
+	Descriptor ocispec.Descriptor
+}
+
+// Resolver discovers the referrers of subject. It first tries the OCI 1.1
+// referrers API against the registry that subject's descriptor came from,
+// and falls back to the cosign tag convention if the registry doesn't
+// support it.
+type Resolver struct {
+	ContentStore content.Store
+	// Resolver is used to pull referrer manifests/blobs once discovered,
+	// and to resolve the cosign fallback tags.
+	Resolver remotes.Resolver
+	// Hosts supplies the same registry host configuration (scheme, and
+	// crucially the Authorizer) that Resolver was built with, so that the
+	// referrers API request below - which isn't expressible through the
+	// remotes.Resolver interface - is authenticated the same way as every
+	// other request diffoci makes to the registry.
+	Hosts docker.RegistryHosts
+}
+
+// Discover returns the referrers of subject in ref's repository.
+func (r *Resolver) Discover(ctx context.Context, ref string, subject ocispec.Descriptor) ([]Referrer, error) {
+	referrers, err := r.discoverViaAPI(ctx, ref, subject)
+	if err == nil {
+		return referrers, nil
+	}
+	return r.discoverViaCosignTag(ctx, ref, subject)
+}
+
+// discoverViaAPI implements the OCI 1.1 referrers API directly: GET
+// /v2/<name>/referrers/<digest>, returning an image index of referrer
+// manifests. There is no such thing as "resolving" a referrers query
+// through remotes.Resolver.Resolve (that API resolves a single
+// tag/digest to one descriptor), so this issues the request itself.
+func (r *Resolver) discoverViaAPI(ctx context.Context, ref string, subject ocispec.Descriptor) ([]Referrer, error) {
+	named, err := reference.ParseNormalizedNamed(stripTagOrDigest(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %q: %w", ref, err)
+	}
+	if r.Hosts == nil {
+		return nil, fmt.Errorf("no registry host configuration available to authenticate the referrers API request")
+	}
+	hosts, err := r.Hosts(reference.Domain(named))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve registry host for %q: %w", reference.Domain(named), err)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no registry host configured for %q", reference.Domain(named))
+	}
+	host := hosts[0]
+	url := fmt.Sprintf("%s://%s%s/v2/%s/referrers/%s", host.Scheme, host.Host, host.Path, reference.Path(named), subject.Digest.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ocispec.MediaTypeImageIndex)
+	if host.Authorizer != nil {
+		if err := host.Authorizer.Authorize(ctx, req); err != nil {
+			return nil, fmt.Errorf("failed to authorize referrers API request to %q: %w", url, err)
+		}
+	}
+	client := host.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("referrers API request to %q failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("referrers API returned %s for %q", resp.Status, url)
+	}
+
+	var idx ocispec.Index
+	if err := json.NewDecoder(resp.Body).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to parse referrers index from %q: %w", url, err)
+	}
+	out := make([]Referrer, 0, len(idx.Manifests))
+	for _, m := range idx.Manifests {
+		out = append(out, Referrer{Kind: classify(m), Descriptor: m})
+	}
+	return out, nil
+}
+
+// discoverViaCosignTag looks up each of the cosign tag conventions
+// (".sig", ".att", ".sbom") in turn, since each suffix is published as a
+// separate tag and only covers one Kind.
+func (r *Resolver) discoverViaCosignTag(ctx context.Context, ref string, subject ocispec.Descriptor) ([]Referrer, error) {
+	var out []Referrer
+	for suffix, kind := range cosignTagSuffixes {
+		tag := cosignTag(subject.Digest, suffix)
+		cosignRef := stripTagOrDigest(ref) + ":" + tag
+		_, desc, err := r.Resolver.Resolve(ctx, cosignRef)
+		if err != nil {
+			// Nothing published under this convention; that's a legitimate
+			// "nothing attached" result for this kind, not an error.
+			continue
+		}
+		out = append(out, Referrer{Kind: kind, Descriptor: desc})
+	}
+	return out, nil
+}
+
+// Payload fetches and returns the signed content of a referrer: the bytes
+// of its sole image layer, which is what was actually signed/attested, as
+// opposed to the signature bytes themselves (which cosign attaches as an
+// annotation on that layer).
+func (r *Resolver) Payload(ctx context.Context, ref string, referrer Referrer) ([]byte, error) {
+	manifestBytes, err := r.fetch(ctx, ref, referrer.Descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch referrer manifest %s: %w", referrer.Descriptor.Digest, err)
+	}
+	var m ocispec.Manifest
+	if err := json.Unmarshal(manifestBytes, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse referrer manifest %s: %w", referrer.Descriptor.Digest, err)
+	}
+	if len(m.Layers) == 0 {
+		return nil, fmt.Errorf("referrer manifest %s has no layers", referrer.Descriptor.Digest)
+	}
+	payload, err := r.fetch(ctx, ref, m.Layers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payload of referrer manifest %s: %w", referrer.Descriptor.Digest, err)
+	}
+	return payload, nil
+}
+
+// CertificateIdentity extracts the subject and issuer of the cosign
+// keyless-signing certificate attached to referrer, if any. Both are empty
+// if referrer was signed with a static key instead of a Fulcio certificate.
+func (r *Resolver) CertificateIdentity(ctx context.Context, ref string, referrer Referrer) (subject, issuer string, err error) {
+	manifestBytes, err := r.fetch(ctx, ref, referrer.Descriptor)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch referrer manifest %s: %w", referrer.Descriptor.Digest, err)
+	}
+	var m ocispec.Manifest
+	if err := json.Unmarshal(manifestBytes, &m); err != nil {
+		return "", "", fmt.Errorf("failed to parse referrer manifest %s: %w", referrer.Descriptor.Digest, err)
+	}
+	pemCert := m.Annotations["dev.sigstore.cosign/certificate"]
+	if pemCert == "" && len(m.Layers) > 0 {
+		pemCert = m.Layers[0].Annotations["dev.sigstore.cosign/certificate"]
+	}
+	if pemCert == "" {
+		return "", "", nil
+	}
+	block, _ := pem.Decode([]byte(pemCert))
+	if block == nil {
+		return "", "", fmt.Errorf("failed to decode certificate PEM attached to referrer manifest %s", referrer.Descriptor.Digest)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse certificate attached to referrer manifest %s: %w", referrer.Descriptor.Digest, err)
+	}
+	return cert.Subject.String(), cert.Issuer.String(), nil
+}
+
+// fetch pulls desc through the full remotes.Resolver (and thus any
+// configured auth), storing it in ContentStore like any other blob
+// diffoci reads, then returns its content.
+func (r *Resolver) fetch(ctx context.Context, ref string, desc ocispec.Descriptor) ([]byte, error) {
+	fetcher, err := r.Resolver.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := remotes.FetchHandler(r.ContentStore, fetcher).Handle(ctx, desc); err != nil {
+		return nil, err
+	}
+	ra, err := r.ContentStore.ReaderAt(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer ra.Close()
+	buf := make([]byte, desc.Size)
+	if _, err := io.ReadFull(content.NewReader(ra), buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func classify(desc ocispec.Descriptor) Kind {
+	switch {
+	case desc.ArtifactType == ArtifactTypeCosignSignature:
+		return KindSignature
+	case desc.ArtifactType == ArtifactTypeInToto:
+		if strings.Contains(desc.Annotations["in-toto.io/predicate-type"], "spdx") ||
+			strings.Contains(desc.Annotations["in-toto.io/predicate-type"], "cyclonedx") {
+			return KindSBOM
+		}
+		return KindAttestation
+	default:
+		return KindOther
+	}
+}
+
+func cosignTag(digest interface{ String() string }, suffix string) string {
+	s := digest.String()
+	return strings.ReplaceAll(s, ":", "-") + suffix
+}
+
+func stripTagOrDigest(ref string) string {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		return ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i >= 0 && strings.LastIndex(ref, "/") < i {
+		return ref[:i]
+	}
+	return ref
+}
@@ -0,0 +1,61 @@
+package referrers
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name string
+		desc ocispec.Descriptor
+		want Kind
+	}{
+		{"cosign signature", ocispec.Descriptor{ArtifactType: ArtifactTypeCosignSignature}, KindSignature},
+		{"spdx attestation", ocispec.Descriptor{
+			ArtifactType: ArtifactTypeInToto,
+			Annotations:  map[string]string{"in-toto.io/predicate-type": "https://spdx.dev/Document"},
+		}, KindSBOM},
+		{"cyclonedx attestation", ocispec.Descriptor{
+			ArtifactType: ArtifactTypeInToto,
+			Annotations:  map[string]string{"in-toto.io/predicate-type": "https://cyclonedx.org/bom"},
+		}, KindSBOM},
+		{"slsa provenance attestation", ocispec.Descriptor{
+			ArtifactType: ArtifactTypeInToto,
+			Annotations:  map[string]string{"in-toto.io/predicate-type": "https://slsa.dev/provenance/v1"},
+		}, KindAttestation},
+		{"unrecognized artifact type", ocispec.Descriptor{ArtifactType: "application/vnd.example.thing"}, KindOther},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := classify(c.desc); got != c.want {
+				t.Errorf("classify(%+v) = %q, want %q", c.desc, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCosignTag(t *testing.T) {
+	d := digest.Digest("sha256:abcdef0123456789")
+	got := cosignTag(d, ".sig")
+	want := "sha256-abcdef0123456789.sig"
+	if got != want {
+		t.Errorf("cosignTag(%q, %q) = %q, want %q", d, ".sig", got, want)
+	}
+}
+
+func TestStripTagOrDigest(t *testing.T) {
+	cases := map[string]string{
+		"registry.example.com/repo:tag":                            "registry.example.com/repo",
+		"registry.example.com/repo@sha256:abcdef0123456789abcdef0": "registry.example.com/repo",
+		"registry.example.com:5000/repo:tag":                       "registry.example.com:5000/repo",
+		"registry.example.com/repo":                                "registry.example.com/repo",
+	}
+	for in, want := range cases {
+		if got := stripTagOrDigest(in); got != want {
+			t.Errorf("stripTagOrDigest(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package report defines diffoci's versioned machine-readable report
+// formats (plain JSON, SARIF, and JUnit XML) for consumption by CI
+// systems, promoting --report-file out of its original experimental,
+// format-unstable state.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+)
+
+// SchemaVersion is bumped whenever a breaking change is made to the JSON
+// report shape below. CI tooling that parses --report-format=json should
+// check it.
+const SchemaVersion = 1
+
+// Document is the top-level --report-format=json document.
+type Document struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	Layers        []Layer `json:"layers"`
+}
+
+// Layer is a single pair of compared layers (or image-level metadata, for
+// the synthetic "image" layer).
+type Layer struct {
+	// Index identifies the layer within the image's history; -1 for the
+	// image-level metadata pseudo-layer.
+	Index int    `json:"index"`
+	Paths []Path `json:"paths,omitempty"`
+}
+
+// Path is a single differing file or directory within a layer.
+type Path struct {
+	Path    string   `json:"path"`
+	Reasons []Reason `json:"reasons"`
+}
+
+// Reason explains one way in which Path differed. RuleID is the name of the
+// --ignore-* flag that would suppress this reason (e.g. "ignore-file-mtime",
+// "extra-ignore-file-mode"), or "file-content", "file-added" or
+// "file-removed" where no flag does. Only differences that were not
+// suppressed appear; the report does not list which rules --semantic
+// disabled.
+type Reason struct {
+	RuleID  string `json:"ruleId"`
+	Message string `json:"message"`
+}
+
+// Format selects the --report-format encoding.
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatSARIF Format = "sarif"
+	FormatJUnit Format = "junit"
+)
+
+// Marshal encodes doc in the given format.
+func Marshal(doc *Document, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON, "":
+		return json.MarshalIndent(doc, "", "  ")
+	case FormatSARIF:
+		return marshalSARIF(doc)
+	case FormatJUnit:
+		return marshalJUnit(doc)
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// sarifLog is a minimal subset of the SARIF 2.1.0 schema, sufficient for
+// GitHub code-scanning to render one result per reason of each differing
+// path.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string   `json:"name"`
+	Rules []string `json:"rules,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func marshalSARIF(doc *Document) ([]byte, error) {
+	log := sarifLog{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{Driver: sarifDriver{Name: "diffoci"}},
+			},
+		},
+	}
+	for _, layer := range doc.Layers {
+		for _, path := range layer.Paths {
+			for _, reason := range path.Reasons {
+				log.Runs[0].Results = append(log.Runs[0].Results, sarifResult{
+					RuleID:  reason.RuleID,
+					Message: sarifMessage{Text: reason.Message},
+					Locations: []sarifLocation{
+						{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: path.Path}}},
+					},
+					PartialFingerprints: map[string]string{
+						"layerIndex": fmt.Sprintf("%d", layer.Index),
+					},
+				})
+			}
+		}
+	}
+	return json.MarshalIndent(log, "", "  ")
+}
+
+// junitTestSuites mirrors the subset of the JUnit XML schema that Jenkins
+// and GitLab's test report parsers understand: one failing <testcase> per
+// differing path, grouped into one <testsuite> per layer.
+type junitTestSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	TestCases []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name    string        `xml:"name,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func marshalJUnit(doc *Document) ([]byte, error) {
+	suites := junitTestSuites{}
+	for _, layer := range doc.Layers {
+		suite := junitSuite{Name: fmt.Sprintf("layer-%d", layer.Index)}
+		for _, path := range layer.Paths {
+			var messages []string
+			for _, reason := range path.Reasons {
+				messages = append(messages, fmt.Sprintf("[%s] %s", reason.RuleID, reason.Message))
+			}
+			suite.Tests++
+			suite.Failures++
+			suite.TestCases = append(suite.TestCases, junitCase{
+				Name: path.Path,
+				Failure: &junitFailure{
+					Message: "content differs",
+					Text:    fmt.Sprintf("%v", messages),
+				},
+			})
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
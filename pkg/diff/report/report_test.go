@@ -0,0 +1,87 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func testDoc() *Document {
+	return &Document{
+		SchemaVersion: SchemaVersion,
+		Layers: []Layer{
+			{
+				Index: 0,
+				Paths: []Path{
+					{Path: "/etc/passwd", Reasons: []Reason{{RuleID: "file-mtime", Message: "mtime differs"}}},
+				},
+			},
+		},
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := Marshal(testDoc(), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Document
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("output is not valid JSON matching Document: %v", err)
+	}
+	if got.SchemaVersion != SchemaVersion || len(got.Layers) != 1 {
+		t.Errorf("roundtrip mismatch: %+v", got)
+	}
+}
+
+func TestMarshalSARIF(t *testing.T) {
+	data, err := Marshal(testDoc(), FormatSARIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got sarifLog
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("output is not valid SARIF JSON: %v", err)
+	}
+	if len(got.Runs) != 1 || len(got.Runs[0].Results) != 1 {
+		t.Fatalf("expected exactly one SARIF result, got %+v", got)
+	}
+	result := got.Runs[0].Results[0]
+	if result.RuleID != "file-mtime" {
+		t.Errorf("RuleID = %q, want %q", result.RuleID, "file-mtime")
+	}
+	if result.Locations[0].PhysicalLocation.ArtifactLocation.URI != "/etc/passwd" {
+		t.Errorf("URI = %q, want %q", result.Locations[0].PhysicalLocation.ArtifactLocation.URI, "/etc/passwd")
+	}
+}
+
+func TestMarshalJUnit(t *testing.T) {
+	data, err := Marshal(testDoc(), FormatJUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("output does not start with the XML header: %q", data[:min(len(data), 40)])
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("output is not valid JUnit XML: %v", err)
+	}
+	if len(got.Suites) != 1 || got.Suites[0].Failures != 1 {
+		t.Fatalf("expected one suite with one failure, got %+v", got)
+	}
+}
+
+func TestMarshalUnknownFormat(t *testing.T) {
+	if _, err := Marshal(testDoc(), Format("yaml")); err == nil {
+		t.Error("expected an error for an unknown report format")
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
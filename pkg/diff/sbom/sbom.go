@@ -0,0 +1,136 @@
+// Package sbom produces a semantic, package-level diff between two SPDX or
+// CycloneDX documents, ignoring fields like timestamps and document UUIDs
+// that change on every build regardless of content.
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Package is a single package/component entry, normalized from either an
+// SPDX "packages[]" entry or a CycloneDX "components[]" entry.
+type Package struct {
+	Name    string
+	Version string
+}
+
+// Diff is the result of comparing two SBOMs.
+type Diff struct {
+	Added          []Package
+	Removed        []Package
+	VersionChanged []VersionChange
+}
+
+// VersionChange is a package present in both SBOMs under the same name but
+// a different version.
+type VersionChange struct {
+	Name       string
+	OldVersion string
+	NewVersion string
+}
+
+// Equal reports whether the two SBOMs are equal, i.e. Diff would be empty.
+func (d *Diff) Equal() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.VersionChanged) == 0
+}
+
+// Compare parses a and b as SPDX or CycloneDX JSON (auto-detected) and
+// returns their package-level diff.
+func Compare(a, b []byte) (*Diff, error) {
+	pa, err := parse(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse first SBOM: %w", err)
+	}
+	pb, err := parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse second SBOM: %w", err)
+	}
+	return compare(pa, pb), nil
+}
+
+func compare(a, b []Package) *Diff {
+	byName := func(pkgs []Package) map[string]Package {
+		m := make(map[string]Package, len(pkgs))
+		for _, p := range pkgs {
+			m[p.Name] = p
+		}
+		return m
+	}
+	am, bm := byName(a), byName(b)
+
+	var d Diff
+	for name, pa := range am {
+		pb, ok := bm[name]
+		if !ok {
+			d.Removed = append(d.Removed, pa)
+			continue
+		}
+		if pa.Version != pb.Version {
+			d.VersionChanged = append(d.VersionChanged, VersionChange{
+				Name:       name,
+				OldVersion: pa.Version,
+				NewVersion: pb.Version,
+			})
+		}
+	}
+	for name, pb := range bm {
+		if _, ok := am[name]; !ok {
+			d.Added = append(d.Added, pb)
+		}
+	}
+	return &d
+}
+
+// spdxDocument is the minimal subset of the SPDX JSON schema needed to
+// extract packages.
+type spdxDocument struct {
+	Packages []struct {
+		Name        string `json:"name"`
+		VersionInfo string `json:"versionInfo"`
+	} `json:"packages"`
+}
+
+// cyclonedxDocument is the minimal subset of the CycloneDX JSON schema
+// needed to extract components.
+type cyclonedxDocument struct {
+	BOMFormat  string `json:"bomFormat"`
+	Components []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"components"`
+}
+
+func parse(data []byte) ([]Package, error) {
+	var probe struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case probe.SPDXVersion != "":
+		var doc spdxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		pkgs := make([]Package, 0, len(doc.Packages))
+		for _, p := range doc.Packages {
+			pkgs = append(pkgs, Package{Name: p.Name, Version: p.VersionInfo})
+		}
+		return pkgs, nil
+	case probe.BOMFormat == "CycloneDX":
+		var doc cyclonedxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		pkgs := make([]Package, 0, len(doc.Components))
+		for _, c := range doc.Components {
+			pkgs = append(pkgs, Package{Name: c.Name, Version: c.Version})
+		}
+		return pkgs, nil
+	default:
+		return nil, fmt.Errorf("unrecognized SBOM format: neither spdxVersion nor bomFormat=CycloneDX is set")
+	}
+}
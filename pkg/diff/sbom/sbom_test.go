@@ -0,0 +1,67 @@
+package sbom
+
+import "testing"
+
+const spdxA = `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {"name": "openssl", "versionInfo": "3.0.2"},
+    {"name": "curl", "versionInfo": "7.81.0"}
+  ]
+}`
+
+const spdxB = `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {"name": "openssl", "versionInfo": "3.0.7"},
+    {"name": "zlib", "versionInfo": "1.2.11"}
+  ]
+}`
+
+func TestCompareSPDX(t *testing.T) {
+	d, err := Compare([]byte(spdxA), []byte(spdxB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Equal() {
+		t.Fatal("expected a diff, got none")
+	}
+	if len(d.Added) != 1 || d.Added[0].Name != "zlib" {
+		t.Errorf("Added = %+v, want [zlib]", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Name != "curl" {
+		t.Errorf("Removed = %+v, want [curl]", d.Removed)
+	}
+	if len(d.VersionChanged) != 1 || d.VersionChanged[0].Name != "openssl" ||
+		d.VersionChanged[0].OldVersion != "3.0.2" || d.VersionChanged[0].NewVersion != "3.0.7" {
+		t.Errorf("VersionChanged = %+v, want [openssl 3.0.2 -> 3.0.7]", d.VersionChanged)
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	d, err := Compare([]byte(spdxA), []byte(spdxA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal() {
+		t.Errorf("expected no diff between a document and itself, got %+v", d)
+	}
+}
+
+func TestCompareCycloneDX(t *testing.T) {
+	a := `{"bomFormat": "CycloneDX", "components": [{"name": "libfoo", "version": "1.0.0"}]}`
+	b := `{"bomFormat": "CycloneDX", "components": [{"name": "libfoo", "version": "1.1.0"}]}`
+	d, err := Compare([]byte(a), []byte(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.VersionChanged) != 1 || d.VersionChanged[0].OldVersion != "1.0.0" || d.VersionChanged[0].NewVersion != "1.1.0" {
+		t.Errorf("VersionChanged = %+v, want [libfoo 1.0.0 -> 1.1.0]", d.VersionChanged)
+	}
+}
+
+func TestCompareUnrecognizedFormat(t *testing.T) {
+	if _, err := Compare([]byte(`{}`), []byte(`{}`)); err == nil {
+		t.Error("expected an error for a document with neither spdxVersion nor bomFormat set")
+	}
+}